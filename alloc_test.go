@@ -9,10 +9,17 @@ package main
 import (
 	"fmt"
 	"runtime"
+	"runtime/debug"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/aclements/go-perfevent/perfbench"
+
+	"github.com/aclements/go-gc-efficiency/internal/allocbench"
+	"github.com/aclements/go-gc-efficiency/internal/perf"
 )
 
 const wordBytes = int(unsafe.Sizeof((*int)(nil)))
@@ -66,6 +73,19 @@ func BenchmarkAllocScalar(b *testing.B) {
 	bench[[32768]word](b)
 }
 
+// BenchmarkAllocClassified samples BenchmarkAllocPtr's size grid (1, 16,
+// 256, 4096, and 32768 pointers), but
+// reports a breakdown of GC pause and scheduler latency percentiles and
+// per-size-class allocation counts instead of a single ns/byte number. See
+// [allocbench.Bench].
+func BenchmarkAllocClassified(b *testing.B) {
+	allocbench.Bench[[1]*byte](b)
+	allocbench.Bench[[16]*byte](b)
+	allocbench.Bench[[256]*byte](b)
+	allocbench.Bench[[4096]*byte](b)
+	allocbench.Bench[[32768]*byte](b)
+}
+
 var sink any
 var alwaysFalse bool
 
@@ -115,6 +135,195 @@ func bench[T any](b *testing.B) {
 	})
 }
 
+// BenchmarkWriteBarrier isolates the GC's write barrier cost: it stores
+// pointers into a pre-allocated slice both while the GC is idle and while
+// it's running back-to-back cycles, so the difference between the two
+// ns/store numbers is the barrier overhead.
+func BenchmarkWriteBarrier(b *testing.B) {
+	const n = 1 << 16
+	values := make([]*word, n)
+	for i := range values {
+		values[i] = new(word)
+	}
+	slots := make([]*word, n)
+
+	storeNsPerOp := func(b *testing.B) float64 {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			slots[i%n] = values[i%n]
+		}
+		b.StopTimer()
+		return float64(b.Elapsed().Nanoseconds()) / float64(b.N)
+	}
+
+	b.Run("mark-idle", func(b *testing.B) {
+		b.ReportMetric(storeNsPerOp(b), "ns/store")
+	})
+
+	b.Run("mark-active", func(b *testing.B) {
+		// Keep the GC cycling for the duration of the benchmark by
+		// holding a live set of up to 256 64 KiB buffers and triggering
+		// GC back-to-back from a background goroutine. Each runtime.GC()
+		// call also sweeps before returning, so the mark phase covers
+		// most, not all, of the timed region.
+		defer debug.SetGCPercent(debug.SetGCPercent(1))
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var live [][]byte
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				live = append(live, make([]byte, 1<<16))
+				if len(live) > 256 {
+					live = live[len(live)-256:]
+				}
+				runtime.GC()
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+
+		b.ReportMetric(storeNsPerOp(b), "ns/store")
+	})
+}
+
+// BenchmarkGCScan is the mark-side counterpart to BenchmarkWriteBarrier: it
+// builds a live set of pointer-dense objects at sizes matching the
+// BenchmarkAllocPtr grid, then times runtime.GC() directly, with
+// StartTimer/StopTimer inverted so only the GC calls themselves are measured,
+// reporting ns per pointer-word scanned.
+func BenchmarkGCScan(b *testing.B) {
+	for _, n := range []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16536, 32768} {
+		b.Run(fmt.Sprintf("words=%d", n), func(b *testing.B) {
+			gcScanBench(b, n)
+		})
+	}
+}
+
+// gcScanBench builds count objects with n pointer-sized words each, all
+// pointing at a single shared leaf so the GC must trace every word without
+// following long chains, then runs b.N rounds of runtime.GC(), reporting
+// ns/ptr-word scanned across just those calls.
+//
+// Each runtime.GC() call pays fixed STW and whole-heap/stack-scan overhead
+// on top of tracing this benchmark's own objects, so at the low end of the
+// sweep (small n, where the benchmark's live set is a small fraction of the
+// process's heap and stacks) that fixed cost dominates and ns/ptr-word is
+// mostly noise rather than a measurement of scan cost. Trust this metric
+// only once n is large enough that the benchmark's own live set dominates
+// the scanned heap.
+func gcScanBench(b *testing.B, n int) {
+	const count = 1024
+
+	leaf := new(word)
+	objs := make([][]*word, count)
+	for i := range objs {
+		obj := make([]*word, n)
+		for j := range obj {
+			obj[j] = leaf
+		}
+		objs[i] = obj
+	}
+	sink = objs
+
+	b.ResetTimer()
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		b.StartTimer()
+		runtime.GC()
+		b.StopTimer()
+	}
+
+	words := float64(n) * count
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/(words*float64(b.N)), "ns/ptr-word")
+}
+
+// BenchmarkAllocParallel sweeps GOMAXPROCS to see how allocation throughput
+// scales with concurrent allocators. Per-P mcache contention, central-cache
+// lock contention on mheap_.lock, and NUMA-remote page effects all show up
+// as throughput that fails to scale linearly with worker count. Each worker
+// pins itself to a distinct CPU with SchedSetaffinity, so comparing
+// GOMAXPROCS values that stay within one core, one socket, or span sockets
+// reveals coherence costs; EventCacheMisses and EventLLCLoadMisses track
+// how that coherence traffic scales with worker count.
+func BenchmarkAllocParallel(b *testing.B) {
+	maxProcs := runtime.NumCPU()
+	for procs := 1; procs <= maxProcs; procs *= 2 {
+		b.Run(fmt.Sprintf("GOMAXPROCS=%d", procs), func(b *testing.B) {
+			allocParallelBench(b, procs)
+		})
+	}
+}
+
+func allocParallelBench(b *testing.B, procs int) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+	var nextWorker atomic.Int64
+	var cacheMisses, llcMisses atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		cpu := int(nextWorker.Add(1)-1) % procs
+		var set unix.CPUSet
+		set.Zero()
+		set.Set(cpu)
+		unix.SchedSetaffinity(0, &set) // best-effort: ignore error if unprivileged
+
+		misses, errMisses := perf.OpenCounter(perf.EventCacheMisses)
+		if errMisses == nil {
+			defer misses.Close()
+			misses.Start()
+			defer misses.Stop()
+		}
+		llc, errLLC := perf.OpenCounter(perf.EventLLCLoadMisses)
+		if errLLC == nil {
+			defer llc.Close()
+			llc.Start()
+			defer llc.Stop()
+		}
+
+		// Use a goroutine-local sink, guarded the same way bench[T] guards
+		// the package-level sink, instead of writing through the shared
+		// sink: concurrent unsynchronized writes there would be a data race.
+		var localSink *word
+		for pb.Next() {
+			x := new(word)
+			if alwaysFalse {
+				localSink = x
+			}
+		}
+		_ = localSink
+
+		if errMisses == nil {
+			if c, err := misses.Read(); err == nil {
+				cacheMisses.Add(int64(c.Value()))
+			}
+		}
+		if errLLC == nil {
+			if c, err := llc.Read(); err == nil {
+				llcMisses.Add(int64(c.Value()))
+			}
+		}
+	})
+	b.StopTimer()
+
+	ns := float64(b.Elapsed().Nanoseconds())
+	b.ReportMetric(ns/float64(wordBytes*b.N), "ns/byte")
+	b.ReportMetric(float64(cacheMisses.Load())/float64(b.N), "cache-misses/op")
+	b.ReportMetric(float64(llcMisses.Load())/float64(b.N), "LLC-load-misses/op")
+}
+
 func BenchmarkZeroLLCMiss(b *testing.B) {
 	// Ensure we have a backing store that doesn't fit in L3.
 	store := make([]byte, llcBytes*2)
@@ -0,0 +1,170 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package allocbench provides a benchmark harness that classifies
+// allocation cost using runtime/metrics histograms, rather than the single
+// ns/byte number the top-level alloc benchmarks report.
+package allocbench
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+var sampleNames = []string{
+	"/gc/pauses:seconds",
+	"/sched/latencies:seconds",
+	"/gc/heap/allocs-by-size:bytes",
+	"/gc/heap/allocs:bytes",
+}
+
+var sink any
+var alwaysFalse bool
+
+// Bench runs b.N allocations of a T and reports p50/p90/p99 GC pause and
+// scheduler latencies, plus a per-size-class allocation count, all sampled
+// from runtime/metrics around the timed region. This lets us see whether
+// allocation cost scales with the allocator's size-class transitions or
+// with GC pause behavior, rather than collapsing both into one number.
+func Bench[T any](b *testing.B) {
+	sizeofT := unsafe.Sizeof(*new(T))
+
+	b.Run(fmt.Sprintf("bytes=%d", sizeofT), func(b *testing.B) {
+		samples := newSamples()
+		metrics.Read(samples)
+		before := cloneSamples(samples)
+
+		b.ResetTimer()
+		for range b.N {
+			x := new(T)
+			if alwaysFalse {
+				sink = x
+			}
+		}
+		b.StopTimer()
+
+		metrics.Read(samples)
+		report(b, before, samples)
+	})
+}
+
+func newSamples() []metrics.Sample {
+	samples := make([]metrics.Sample, len(sampleNames))
+	for i, name := range sampleNames {
+		samples[i].Name = name
+	}
+	return samples
+}
+
+// beforeValue is a deep copy of a metrics.Sample's Value, safe to hold
+// across a later metrics.Read into the same []metrics.Sample. metrics.Read
+// reuses a histogram's underlying Counts storage in place on the next call,
+// so a shallow copy of []metrics.Sample (or of a metrics.Value) is not
+// enough to keep a "before" snapshot stable; see the runtime/metrics package
+// doc on Value.
+type beforeValue struct {
+	u64  uint64
+	hist *metrics.Float64Histogram // copied; nil unless the sample is a histogram
+}
+
+// cloneSamples deep-copies the current Sample values so they stay stable
+// across a later re-read of samples into the same slice.
+func cloneSamples(in []metrics.Sample) []beforeValue {
+	out := make([]beforeValue, len(in))
+	for i, s := range in {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			out[i].u64 = s.Value.Uint64()
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			counts := make([]uint64, len(h.Counts))
+			copy(counts, h.Counts)
+			buckets := make([]float64, len(h.Buckets))
+			copy(buckets, h.Buckets)
+			out[i].hist = &metrics.Float64Histogram{Counts: counts, Buckets: buckets}
+		}
+	}
+	return out
+}
+
+func report(b *testing.B, before []beforeValue, after []metrics.Sample) {
+	for i, name := range sampleNames {
+		switch name {
+		case "/gc/pauses:seconds", "/sched/latencies:seconds":
+			reportLatencies(b, name, before[i].hist, after[i].Value.Float64Histogram())
+		case "/gc/heap/allocs-by-size:bytes":
+			reportSizeClasses(b, before[i].hist, after[i].Value.Float64Histogram())
+		case "/gc/heap/allocs:bytes":
+			delta := after[i].Value.Uint64() - before[i].u64
+			b.ReportMetric(float64(delta)/float64(b.N), "bytes-alloc/op")
+		}
+	}
+}
+
+// deltaHistogram returns the bucket-count difference between two
+// runtime/metrics histogram samples of the same shape.
+func deltaHistogram(before, after *metrics.Float64Histogram) *metrics.Float64Histogram {
+	counts := make([]uint64, len(after.Counts))
+	for i := range counts {
+		counts[i] = after.Counts[i] - before.Counts[i]
+	}
+	return &metrics.Float64Histogram{Counts: counts, Buckets: after.Buckets}
+}
+
+func reportLatencies(b *testing.B, name string, before, after *metrics.Float64Histogram) {
+	d := deltaHistogram(before, after)
+	label := strings.TrimSuffix(strings.TrimPrefix(name, "/"), ":seconds")
+	for _, p := range []struct {
+		q   float64
+		tag string
+	}{{0.5, "p50"}, {0.9, "p90"}, {0.99, "p99"}} {
+		b.ReportMetric(percentile(d, p.q)*1e9, label+"-"+p.tag+"-ns")
+	}
+}
+
+func reportSizeClasses(b *testing.B, before, after *metrics.Float64Histogram) {
+	d := deltaHistogram(before, after)
+	for i, c := range d.Counts {
+		if c == 0 {
+			continue
+		}
+		size := bucketMean(d.Buckets[i], d.Buckets[i+1])
+		b.ReportMetric(float64(c)/float64(b.N), fmt.Sprintf("allocs-size=%.0fB/op", size))
+	}
+}
+
+// percentile approximates the q-th quantile of h by walking its cumulative
+// bucket counts and returning the midpoint of the bucket containing that
+// rank.
+func percentile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	target := uint64(q * float64(total))
+	var cum uint64
+	for i, c := range h.Counts {
+		cum += c
+		if cum > target {
+			return bucketMean(h.Buckets[i], h.Buckets[i+1])
+		}
+	}
+	return bucketMean(h.Buckets[len(h.Buckets)-2], h.Buckets[len(h.Buckets)-1])
+}
+
+// bucketMean approximates a histogram bucket [lo, hi) by its midpoint,
+// falling back to lo for the open-ended top bucket.
+func bucketMean(lo, hi float64) float64 {
+	if math.IsInf(hi, 1) {
+		return lo
+	}
+	return (lo + hi) / 2
+}
@@ -43,42 +43,93 @@ var (
 
 type Counter struct {
 	f *os.File
+
+	// The following are only set for a sampling Counter opened with
+	// [OpenSampledCounter].
+	ring       []byte // mmap'd perf ring buffer, including its header page
+	ringData   []byte // ring, with the header page stripped off
+	sampleType SampleType
+	done       chan struct{}
 }
 
-// OpenCounter returns a new [Counter] that reads values for the given [Event]
-// on the current goroutine. It calls [runtime.LockOSThread] to tie this
-// goroutine to a thread because perf is a thread-oriented API. Callers are
-// expected to call [Counter.Close] to unlock the thread.
-func OpenCounter(event Event) (*Counter, error) {
+// open opens a perf_event fd for event. If groupFd is non-negative, the
+// returned fd joins the event group led by groupFd and shares its enable
+// state; otherwise the fd is its own group leader and starts disabled.
+// group requests PERF_FORMAT_GROUP, which must be set on both the leader's
+// attr (so reading the leader's fd returns every member's value) and each
+// follower's attr (so the kernel accepts them as group members).
+func open(event Event, groupFd int, group bool) (*os.File, error) {
 	attr := unix.PerfEventAttr{}
 	attr.Size = uint32(unsafe.Sizeof(attr))
 	if err := event.setAttrs(&attr); err != nil {
 		return nil, err
 	}
 	attr.Read_format = unix.PERF_FORMAT_TOTAL_TIME_ENABLED | unix.PERF_FORMAT_TOTAL_TIME_RUNNING
-	attr.Bits = unix.PerfBitDisabled
+	if group {
+		attr.Read_format |= unix.PERF_FORMAT_GROUP
+	}
 
 	// XXX
 	attr.Bits |= unix.PerfBitExcludeKernel
 
+	if groupFd < 0 {
+		attr.Bits |= unix.PerfBitDisabled
+	}
+
+	fd, err := unix.PerfEventOpen(&attr, 0, -1, groupFd, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "<perf-event>"), nil
+}
+
+// OpenCounter returns a new [Counter] that reads values for the given [Event]
+// on the current goroutine. It calls [runtime.LockOSThread] to tie this
+// goroutine to a thread because perf is a thread-oriented API. Callers are
+// expected to call [Counter.Close] to unlock the thread.
+func OpenCounter(event Event) (*Counter, error) {
 	runtime.LockOSThread()
-	fd, err := unix.PerfEventOpen(&attr, 0, -1, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	f, err := open(event, -1, false)
 	if err != nil {
+		runtime.UnlockOSThread()
 		return nil, err
 	}
-	f := os.NewFile(uintptr(fd), "<perf-event>")
+	return &Counter{f: f}, nil
+}
 
-	return &Counter{f}, nil
+// Supported reports whether event can be opened on this system. It opens and
+// immediately closes a throwaway [Counter] for event, so it briefly locks the
+// calling goroutine's thread.
+func Supported(event Event) bool {
+	c, err := OpenCounter(event)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
 }
 
 func (c *Counter) Close() {
 	if c == nil {
 		return
 	}
+	if c.done != nil {
+		close(c.done)
+	}
+	if c.ring != nil {
+		unix.Munmap(c.ring)
+	}
 	// TODO: Ignore double close
 	runtime.UnlockOSThread()
 }
 
+// PollFD returns the file descriptor underlying c, suitable for use with
+// epoll or similar to wait for activity (such as a sampling wakeup,
+// see [SampleConfig.WakeupEvents]) without busy-polling [Counter.Samples].
+func (c *Counter) PollFD() int {
+	return int(c.f.Fd())
+}
+
 func (c *Counter) Start() {
 	// TODO: Ignore double start
 	if c == nil {
@@ -0,0 +1,189 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package perf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	EventPageFaults      = eventBasic{"page-faults", unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_PAGE_FAULTS}
+	EventContextSwitches = eventBasic{"context-switches", unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CONTEXT_SWITCHES}
+	EventCPUMigrations   = eventBasic{"cpu-migrations", unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CPU_MIGRATIONS}
+)
+
+// eventHWCache is a PERF_TYPE_HW_CACHE event, selected by a (cache, op,
+// result) triple that the kernel packs into Config as cache | op<<8 |
+// result<<16.
+type eventHWCache struct {
+	name   string
+	cache  uint64
+	op     uint64
+	result uint64
+}
+
+func (e eventHWCache) setAttrs(a *unix.PerfEventAttr) error {
+	a.Type = unix.PERF_TYPE_HW_CACHE
+	a.Config = e.cache | e.op<<8 | e.result<<16
+	return nil
+}
+
+func (e eventHWCache) String() string {
+	return e.name
+}
+
+var (
+	EventL1DLoadMisses  = eventHWCache{"L1-dcache-load-misses", unix.PERF_COUNT_HW_CACHE_L1D, unix.PERF_COUNT_HW_CACHE_OP_READ, unix.PERF_COUNT_HW_CACHE_RESULT_MISS}
+	EventLLCLoadMisses  = eventHWCache{"LLC-load-misses", unix.PERF_COUNT_HW_CACHE_LL, unix.PERF_COUNT_HW_CACHE_OP_READ, unix.PERF_COUNT_HW_CACHE_RESULT_MISS}
+	EventDTLBLoadMisses = eventHWCache{"dTLB-load-misses", unix.PERF_COUNT_HW_CACHE_DTLB, unix.PERF_COUNT_HW_CACHE_OP_READ, unix.PERF_COUNT_HW_CACHE_RESULT_MISS}
+)
+
+// NewTracepointEvent returns an [Event] for the kernel tracepoint named
+// system:name (for example "kmem:mm_page_alloc"), looking up its numeric ID
+// under /sys/kernel/debug/tracing/events. This requires read access to
+// debugfs, which usually means running as root.
+func NewTracepointEvent(system, name string) (Event, error) {
+	path := filepath.Join("/sys/kernel/debug/tracing/events", system, name, "id")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("perf: reading tracepoint id: %w", err)
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("perf: parsing tracepoint id from %s: %w", path, err)
+	}
+	return eventBasic{system + ":" + name, unix.PERF_TYPE_TRACEPOINT, id}, nil
+}
+
+// eventRaw is a PERF_TYPE_RAW (or other numerically-typed) event with
+// already-encoded Config/Config1/Config2 values, as produced by
+// [ParseRawEvent].
+type eventRaw struct {
+	name    string
+	typ     uint32
+	config  uint64
+	config1 uint64
+	config2 uint64
+}
+
+func (e eventRaw) setAttrs(a *unix.PerfEventAttr) error {
+	a.Type = e.typ
+	a.Config = e.config
+	// PerfEventAttr names the kernel's config1/config2 fields Ext1/Ext2
+	// (they share a union with bp_addr/bp_len in struct perf_event_attr).
+	a.Ext1 = e.config1
+	a.Ext2 = e.config2
+	return nil
+}
+
+func (e eventRaw) String() string {
+	return e.name
+}
+
+// ParseRawEvent parses a raw PMU event description such as
+// "event=0x2e,umask=0x41" against the format fields declared under
+// /sys/devices/<pmu>/format and returns an [Event] for it. pmu names a
+// directory under /sys/devices, e.g. "cpu" for the core PMU; see
+// /sys/devices/<pmu>/events for vendor-documented event strings.
+func ParseRawEvent(pmu, desc string) (Event, error) {
+	base := filepath.Join("/sys/devices", pmu)
+
+	typRaw, err := os.ReadFile(filepath.Join(base, "type"))
+	if err != nil {
+		return nil, fmt.Errorf("perf: reading PMU type: %w", err)
+	}
+	typ, err := strconv.ParseUint(strings.TrimSpace(string(typRaw)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("perf: parsing PMU type: %w", err)
+	}
+
+	var config, config1, config2 uint64
+	for _, term := range strings.Split(desc, ",") {
+		key, val, ok := strings.Cut(term, "=")
+		if !ok {
+			return nil, fmt.Errorf("perf: malformed event term %q", term)
+		}
+		reg, ranges, err := parseFormatRanges(filepath.Join(base, "format", key))
+		if err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseUint(val, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("perf: parsing value for %q: %w", key, err)
+		}
+		bits := placeBits(v, ranges)
+		switch reg {
+		case "config":
+			config |= bits
+		case "config1":
+			config1 |= bits
+		case "config2":
+			config2 |= bits
+		default:
+			// The kernel also defines config3 for some PMUs, which
+			// perf_event_attr has no field for; rather than silently
+			// misprogram the event, refuse it.
+			return nil, fmt.Errorf("perf: format field %q of %q selects unsupported register %q", key, pmu, reg)
+		}
+	}
+
+	return eventRaw{pmu + "/" + desc + "/", uint32(typ), config, config1, config2}, nil
+}
+
+// bitRange is an inclusive [lo, hi] bit range within one of an event's
+// Config/Config1/Config2 registers.
+type bitRange struct{ lo, hi uint }
+
+// parseFormatRanges reads a PMU format file (e.g.
+// /sys/devices/cpu/format/umask), which contains a line like "config:8-15"
+// or "config1:21,40-43", and returns which register (as named in the file,
+// such as "config", "config1", or "config2") it selects bits from, and which
+// bit ranges within it.
+func parseFormatRanges(path string) (reg string, ranges []bitRange, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("perf: reading format %q: %w", path, err)
+	}
+	reg, spec, ok := strings.Cut(strings.TrimSpace(string(data)), ":")
+	if !ok {
+		return "", nil, fmt.Errorf("perf: malformed format file %q", path)
+	}
+	for _, part := range strings.Split(spec, ",") {
+		lo, hi, hasHi := strings.Cut(part, "-")
+		loN, err := strconv.ParseUint(lo, 10, 32)
+		if err != nil {
+			return "", nil, fmt.Errorf("perf: malformed format range %q in %q: %w", part, path, err)
+		}
+		hiN := loN
+		if hasHi {
+			hiN, err = strconv.ParseUint(hi, 10, 32)
+			if err != nil {
+				return "", nil, fmt.Errorf("perf: malformed format range %q in %q: %w", part, path, err)
+			}
+		}
+		ranges = append(ranges, bitRange{uint(loN), uint(hiN)})
+	}
+	return reg, ranges, nil
+}
+
+// placeBits scatters the low bits of v across ranges, in order, the way the
+// kernel does for format fields that span multiple, possibly discontiguous,
+// bit ranges.
+func placeBits(v uint64, ranges []bitRange) uint64 {
+	var out uint64
+	for _, r := range ranges {
+		width := r.hi - r.lo + 1
+		mask := (uint64(1) << width) - 1
+		out |= (v & mask) << r.lo
+		v >>= width
+	}
+	return out
+}
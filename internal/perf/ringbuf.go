@@ -0,0 +1,130 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package perf
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Kernel's struct perf_event_mmap_page header layout, for reference (see
+// "perf_event_mmap_page" in linux/perf_event.h). The header occupies the
+// mapping's first page; the ring data follows starting at the second page,
+// regardless of page size.
+const (
+	mmapDataHeadOff = 1024 // __u64 data_head
+	mmapDataTailOff = 1032 // __u64 data_tail
+)
+
+// dataHead returns the kernel's current write position into the ring
+// buffer, in bytes since the ring began (not yet wrapped to its size).
+func (c *Counter) dataHead() uint64 {
+	return binary.NativeEndian.Uint64(c.ring[mmapDataHeadOff:])
+}
+
+// dataTail returns our own read position into the ring buffer.
+func (c *Counter) dataTail() uint64 {
+	return binary.NativeEndian.Uint64(c.ring[mmapDataTailOff:])
+}
+
+// setDataTail advances our read position, telling the kernel it may reuse
+// the ring space before v.
+func (c *Counter) setDataTail(v uint64) {
+	binary.NativeEndian.PutUint64(c.ring[mmapDataTailOff:], v)
+}
+
+// waitForData blocks until the ring buffer has unread data, c is closed, or
+// an error occurs, returning false in the latter two cases.
+func (c *Counter) waitForData() bool {
+	fds := []unix.PollFd{{Fd: int32(c.f.Fd()), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-c.done:
+			return false
+		default:
+		}
+		n, err := unix.Poll(fds, 100) // ms; re-checked against c.done above
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return false
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// decodeRecord decodes the ring buffer record at byte offset tail (modulo
+// the ring's size) and returns the decoded [Sample] (nil for record types
+// other than PERF_RECORD_SAMPLE) along with the record's size in bytes.
+func (c *Counter) decodeRecord(tail uint64) (*Sample, int, error) {
+	data := c.ringData
+	mask := uint64(len(data)) - 1
+
+	read := func(off uint64, n int) []byte {
+		buf := make([]byte, n)
+		for i := range buf {
+			buf[i] = data[(off+uint64(i))&mask]
+		}
+		return buf
+	}
+
+	hdr := read(tail, 8)
+	typ := binary.NativeEndian.Uint32(hdr[0:])
+	size := binary.NativeEndian.Uint16(hdr[6:])
+	if size < 8 {
+		return nil, 0, fmt.Errorf("perf: malformed ring buffer record (size %d)", size)
+	}
+	if typ != unix.PERF_RECORD_SAMPLE {
+		return nil, int(size), nil
+	}
+
+	body := read(tail+8, int(size)-8)
+	var s Sample
+	var off int
+	if c.sampleType&SampleIP != 0 {
+		s.IP = binary.NativeEndian.Uint64(body[off:])
+		off += 8
+	}
+	if c.sampleType&SampleTID != 0 {
+		s.PID = binary.NativeEndian.Uint32(body[off:])
+		s.TID = binary.NativeEndian.Uint32(body[off+4:])
+		off += 8
+	}
+	if c.sampleType&SampleTime != 0 {
+		s.Time = binary.NativeEndian.Uint64(body[off:])
+		off += 8
+	}
+	if c.sampleType&SampleAddr != 0 {
+		s.Addr = binary.NativeEndian.Uint64(body[off:])
+		off += 8
+	}
+	if c.sampleType&SampleCPU != 0 {
+		s.CPU = binary.NativeEndian.Uint32(body[off:])
+		off += 8 // cpu, reserved
+	}
+	if c.sampleType&SampleCallchain != 0 {
+		nr := binary.NativeEndian.Uint64(body[off:])
+		off += 8
+		s.Callchain = make([]uint64, nr)
+		for i := range s.Callchain {
+			s.Callchain[i] = binary.NativeEndian.Uint64(body[off:])
+			off += 8
+		}
+	}
+	return &s, int(size), nil
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
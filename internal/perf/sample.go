@@ -0,0 +1,166 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package perf
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SampleType selects which fields are present in each [Sample] delivered by
+// [Counter.Samples]. Types can be combined with |.
+type SampleType uint64
+
+const (
+	SampleIP        SampleType = unix.PERF_SAMPLE_IP
+	SampleTID       SampleType = unix.PERF_SAMPLE_TID
+	SampleTime      SampleType = unix.PERF_SAMPLE_TIME
+	SampleAddr      SampleType = unix.PERF_SAMPLE_ADDR
+	SampleCPU       SampleType = unix.PERF_SAMPLE_CPU
+	SampleCallchain SampleType = unix.PERF_SAMPLE_CALLCHAIN
+)
+
+// defaultRingPages is the default size, in pages, of a sampling Counter's
+// mmap'd ring buffer, not counting its header page.
+const defaultRingPages = 64
+
+// SampleConfig configures a sampling [Counter] opened with
+// [OpenSampledCounter].
+type SampleConfig struct {
+	// Period requests a sample every Period occurrences of the event. If
+	// Freq is non-zero, Freq takes precedence and the kernel instead
+	// samples at approximately Freq Hz, adjusting the effective period
+	// over time.
+	Period uint64
+	Freq   uint64
+
+	// Types selects which fields [Counter.Samples] populates in each
+	// [Sample].
+	Types SampleType
+
+	// WakeupEvents, if non-zero, asks the kernel to make c's fd readable
+	// (see [Counter.PollFD]) every WakeupEvents samples.
+	WakeupEvents uint32
+
+	// RingPages is the size of the mmap'd sample ring buffer, in pages. It
+	// is rounded up to a power of two, and defaults to 64.
+	RingPages int
+}
+
+// OpenSampledCounter is like [OpenCounter], but opens event in sampling
+// mode: rather than just counting, the kernel periodically writes
+// PERF_RECORD_SAMPLE records describing the running program to an mmap'd
+// ring buffer, which [Counter.Samples] decodes and streams out.
+func OpenSampledCounter(event Event, cfg SampleConfig) (*Counter, error) {
+	runtime.LockOSThread()
+
+	attr := unix.PerfEventAttr{}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+	if err := event.setAttrs(&attr); err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	attr.Read_format = unix.PERF_FORMAT_TOTAL_TIME_ENABLED | unix.PERF_FORMAT_TOTAL_TIME_RUNNING
+	attr.Bits = unix.PerfBitDisabled
+	attr.Bits |= unix.PerfBitExcludeKernel
+	attr.Sample_type = uint64(cfg.Types)
+	attr.Wakeup = cfg.WakeupEvents
+	if cfg.Freq != 0 {
+		attr.Bits |= unix.PerfBitFreq
+		attr.Sample = cfg.Freq
+	} else {
+		attr.Sample = cfg.Period
+	}
+
+	fd, err := unix.PerfEventOpen(&attr, 0, -1, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "<perf-event>")
+
+	ringPages := cfg.RingPages
+	if ringPages == 0 {
+		ringPages = defaultRingPages
+	}
+	ringPages = nextPowerOfTwo(ringPages)
+	pageSize := os.Getpagesize()
+	ring, err := unix.Mmap(int(fd), 0, (1+ringPages)*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("perf: mmap sample ring buffer: %w", err)
+	}
+
+	return &Counter{
+		f:          f,
+		ring:       ring,
+		ringData:   ring[pageSize:],
+		sampleType: cfg.Types,
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Sample is a single decoded PERF_RECORD_SAMPLE record read from a sampling
+// [Counter]'s ring buffer. Only the fields selected by the [SampleType] the
+// counter was opened with are populated.
+type Sample struct {
+	IP        uint64
+	PID, TID  uint32
+	Time      uint64
+	Addr      uint64
+	CPU       uint32
+	Callchain []uint64 // present if SampleCallchain was requested
+}
+
+// Samples starts a background goroutine that drains PERF_RECORD_SAMPLE
+// records from c's ring buffer as they arrive and decodes them into
+// [Sample]s on the returned channel. The goroutine, and the channel, stop
+// once c is closed. c must have been opened with [OpenSampledCounter].
+func (c *Counter) Samples() (<-chan Sample, error) {
+	if c.ring == nil {
+		return nil, fmt.Errorf("perf: Samples called on a Counter that is not in sampling mode")
+	}
+
+	out := make(chan Sample)
+	go func() {
+		defer close(out)
+		for {
+			head := c.dataHead()
+			tail := c.dataTail()
+			for tail != head {
+				sample, n, err := c.decodeRecord(tail)
+				if err != nil {
+					return
+				}
+				tail += uint64(n)
+				if sample == nil {
+					continue
+				}
+				select {
+				case out <- *sample:
+				case <-c.done:
+					c.setDataTail(tail)
+					return
+				}
+			}
+			c.setDataTail(tail)
+
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			if !c.waitForData() {
+				return
+			}
+		}
+	}()
+	return out, nil
+}